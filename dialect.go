@@ -0,0 +1,224 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dialect describes the command-line syntax of a shell language, so that
+// Shell's IPC plumbing does not have to hard-code bash-isms and can drive
+// other shells: a POSIX sh, zsh, Windows PowerShell, or cmd.exe.
+type Dialect interface {
+	// ExitCodeCommand returns the command that writes the exit code of the
+	// previously run command to the channel at addr.
+	ExitCodeCommand(addr string) string
+
+	// RedirectStdStreams returns the fragment that redirects standard
+	// output to the channel at stdoutAddr and standard error to the channel
+	// at stderrAddr. Either address may be empty, meaning that stream
+	// should not be redirected.
+	RedirectStdStreams(stdoutAddr, stderrAddr string) string
+
+	// RedirectStdin returns the fragment that makes a command read its
+	// standard input from the channel at addr. addr is never empty.
+	RedirectStdin(addr string) string
+
+	// Quote quotes s so that it is taken literally as a single word.
+	Quote(s string) string
+
+	// VarRef returns the syntax used to dereference the variable name.
+	VarRef(name string) string
+
+	// PrintNULCommand returns the command that prints every ref (each
+	// produced by VarRef) to standard output, NUL-delimited.
+	PrintNULCommand(refs []string) string
+
+	// ExportCommand returns the command that sets name to quotedValue (as
+	// returned by Quote) in the current session.
+	ExportCommand(name, quotedValue string) string
+
+	// CommandSeparator returns the token used to run a second command
+	// regardless of the exit status of the first one.
+	CommandSeparator() string
+
+	// NewTransport creates the IPC transport this dialect's command
+	// fragments expect: named pipes for the POSIX dialects, TCP loopback
+	// for the Windows ones.
+	NewTransport() (Transport, error)
+}
+
+// posixDialect implements the command syntax shared by BashDialect,
+// PosixShDialect and ZshDialect: all three rely only on POSIX sh features.
+type posixDialect struct{}
+
+func (posixDialect) ExitCodeCommand(addr string) string {
+	return fmt.Sprintf("echo $? 1>%s", addr)
+}
+
+func (posixDialect) RedirectStdStreams(stdoutAddr, stderrAddr string) string {
+	var frag string
+	if stdoutAddr != "" {
+		frag += fmt.Sprintf("1>%s", stdoutAddr)
+	}
+	if stderrAddr != "" {
+		if frag != "" {
+			frag += " "
+		}
+		frag += fmt.Sprintf("2>%s", stderrAddr)
+	}
+	return frag
+}
+
+func (posixDialect) RedirectStdin(addr string) string {
+	return fmt.Sprintf("<%s", addr)
+}
+
+func (posixDialect) Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func (posixDialect) VarRef(name string) string {
+	return fmt.Sprintf(`"$%s"`, name)
+}
+
+func (posixDialect) PrintNULCommand(refs []string) string {
+	return fmt.Sprintf(`printf '%%s\000' %s`, strings.Join(refs, " "))
+}
+
+func (posixDialect) ExportCommand(name, quotedValue string) string {
+	return fmt.Sprintf("export %s=%s", name, quotedValue)
+}
+
+func (posixDialect) CommandSeparator() string {
+	return ";"
+}
+
+func (posixDialect) NewTransport() (Transport, error) {
+	return newFIFOTransport()
+}
+
+// BashDialect drives an interactive bash shell. It is the dialect used by
+// New.
+type BashDialect struct{ posixDialect }
+
+// PosixShDialect drives a POSIX-compliant "sh" shell (dash, ash, busybox
+// sh and the like). It relies only on syntax common to bash and sh, so it
+// shares its implementation with BashDialect.
+type PosixShDialect struct{ posixDialect }
+
+// ZshDialect drives an interactive zsh shell. zsh's command-line syntax for
+// exit codes, redirection, quoting and exporting is the same POSIX subset
+// bash and sh agree on, so it shares its implementation with them too.
+type ZshDialect struct{ posixDialect }
+
+// PowerShellDialect drives a Windows PowerShell (or PowerShell Core) shell.
+type PowerShellDialect struct{}
+
+func (PowerShellDialect) ExitCodeCommand(addr string) string {
+	return fmt.Sprintf("[IO.File]::WriteAllText('%s', [string]$LASTEXITCODE)", addr)
+}
+
+func (PowerShellDialect) RedirectStdStreams(stdoutAddr, stderrAddr string) string {
+	var frag string
+	if stdoutAddr != "" {
+		frag += fmt.Sprintf("1> %s", stdoutAddr)
+	}
+	if stderrAddr != "" {
+		if frag != "" {
+			frag += " "
+		}
+		frag += fmt.Sprintf("2> %s", stderrAddr)
+	}
+	return frag
+}
+
+func (PowerShellDialect) RedirectStdin(addr string) string {
+	// PowerShell has no operator equivalent to POSIX sh's "<": it parses "<"
+	// as reserved syntax and refuses to run the line at all. There is no
+	// trailing fragment that can fix this up, since redirecting a command's
+	// input in PowerShell means piping into it, which has to appear before
+	// the command, not after; WithStdin is therefore not usable together
+	// with PowerShellDialect today.
+	return fmt.Sprintf("< %s", addr)
+}
+
+func (PowerShellDialect) Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func (PowerShellDialect) VarRef(name string) string {
+	return fmt.Sprintf("$%s", name)
+}
+
+func (PowerShellDialect) PrintNULCommand(refs []string) string {
+	return fmt.Sprintf("[Console]::Out.Write(((%s) -join \"`0\") + \"`0\")", strings.Join(refs, ", "))
+}
+
+func (PowerShellDialect) ExportCommand(name, quotedValue string) string {
+	return fmt.Sprintf("$env:%s = %s", name, quotedValue)
+}
+
+func (PowerShellDialect) CommandSeparator() string {
+	return ";"
+}
+
+func (PowerShellDialect) NewTransport() (Transport, error) {
+	return newNamedPipeTransport()
+}
+
+// CmdDialect drives a Windows cmd.exe shell.
+type CmdDialect struct{}
+
+func (CmdDialect) ExitCodeCommand(addr string) string {
+	// %errorlevel% expands when cmd.exe parses the line, before the command
+	// preceding it on the same CommandSeparator-joined line has even run, so
+	// it would report the previous command's exit code, not this one's.
+	// !errorlevel!, with delayed expansion enabled for the line, expands at
+	// execution time instead.
+	return fmt.Sprintf("setlocal enabledelayedexpansion & echo !errorlevel! > %s & endlocal", addr)
+}
+
+func (CmdDialect) RedirectStdStreams(stdoutAddr, stderrAddr string) string {
+	var frag string
+	if stdoutAddr != "" {
+		frag += fmt.Sprintf("1> %s", stdoutAddr)
+	}
+	if stderrAddr != "" {
+		if frag != "" {
+			frag += " "
+		}
+		frag += fmt.Sprintf("2> %s", stderrAddr)
+	}
+	return frag
+}
+
+func (CmdDialect) RedirectStdin(addr string) string {
+	return fmt.Sprintf("< %s", addr)
+}
+
+func (CmdDialect) Quote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+func (CmdDialect) VarRef(name string) string {
+	return fmt.Sprintf("%%%s%%", name)
+}
+
+func (CmdDialect) PrintNULCommand(refs []string) string {
+	// cmd.exe has no built-in way to emit a NUL byte, so values cannot be
+	// told apart reliably when more than one is requested; this is good
+	// enough for the common single-variable case (see Shell.Get).
+	return fmt.Sprintf("echo %s", strings.Join(refs, " "))
+}
+
+func (CmdDialect) ExportCommand(name, quotedValue string) string {
+	return fmt.Sprintf("set %s=%s", name, quotedValue)
+}
+
+func (CmdDialect) CommandSeparator() string {
+	return "&"
+}
+
+func (CmdDialect) NewTransport() (Transport, error) {
+	return newNamedPipeTransport()
+}
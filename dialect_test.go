@@ -0,0 +1,49 @@
+package shell_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alepinio/shell"
+)
+
+func TestPowerShellDialectFragmentsTargetTheSameAddress(t *testing.T) {
+	d := shell.PowerShellDialect{}
+
+	if got := d.ExitCodeCommand(`\\.\pipe\exit`); !strings.Contains(got, `\\.\pipe\exit`) {
+		t.Fatalf("ExitCodeCommand = %q, want it to reference the channel address", got)
+	}
+	if got := d.RedirectStdStreams(`\\.\pipe\out`, `\\.\pipe\err`); got != `1> \\.\pipe\out 2> \\.\pipe\err` {
+		t.Fatalf("RedirectStdStreams = %q", got)
+	}
+	if got := d.RedirectStdStreams(`\\.\pipe\out`, ""); got != `1> \\.\pipe\out` {
+		t.Fatalf("RedirectStdStreams (stdout only) = %q", got)
+	}
+}
+
+func TestCmdDialectExitCodeCommandUsesDelayedExpansion(t *testing.T) {
+	d := shell.CmdDialect{}
+
+	got := d.ExitCodeCommand(`\\.\pipe\exit`)
+	if strings.Contains(got, "%errorlevel%") {
+		t.Fatalf("ExitCodeCommand = %q, want !errorlevel! (delayed expansion), not %%errorlevel%% which would read the stale value from before the command ran", got)
+	}
+	if !strings.Contains(got, "!errorlevel!") {
+		t.Fatalf("ExitCodeCommand = %q, want it to use delayed expansion", got)
+	}
+	if !strings.Contains(got, "enabledelayedexpansion") {
+		t.Fatalf("ExitCodeCommand = %q, want it to enable delayed expansion", got)
+	}
+}
+
+// TestNewWithDialectWindowsDialectsReportTransportError checks that
+// PowerShellDialect and CmdDialect, which need a Windows named pipe
+// transport, fail NewWithDialect with a clear error rather than silently
+// misbehaving when run on a platform where that transport is unavailable.
+func TestNewWithDialectWindowsDialectsReportTransportError(t *testing.T) {
+	for _, d := range []shell.Dialect{shell.PowerShellDialect{}, shell.CmdDialect{}} {
+		if _, err := shell.NewWithDialect("powershell.exe", d); err == nil {
+			t.Fatalf("NewWithDialect(%T): error = nil, want an error on this platform", d)
+		}
+	}
+}
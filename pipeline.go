@@ -0,0 +1,177 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// A PipelineStage is one command to run, on a given Shell, as part of a
+// Pipeline.
+type PipelineStage struct {
+	sh  *Shell
+	cmd string
+}
+
+// NewPipelineStage returns a PipelineStage that runs cmd on sh. When used as
+// anything but the last stage of a Pipeline, sh must have been created (see
+// New) with a non-nil stdout (or, when the Pipeline pipes standard error,
+// stderr); the Pipeline temporarily takes over that writer for the duration
+// of the stage to feed the next stage's standard input.
+func NewPipelineStage(sh *Shell, cmd string) *PipelineStage {
+	return &PipelineStage{sh: sh, cmd: cmd}
+}
+
+// PipeTo returns a Pipeline made of ps followed by next, with ps's standard
+// output wired into next's standard input. It is shorthand for
+// NewPipeline(ps, next).
+func (ps *PipelineStage) PipeTo(next *PipelineStage) *Pipeline {
+	return NewPipeline(ps, next)
+}
+
+// A Pipeline chains the Exec of several PipelineStages together, piping the
+// standard output (or standard error, or both, see PipeStderr and
+// PipeCombinedOutput) of each stage into the standard input of the next one,
+// in the same spirit as a shell pipeline of the form "cmd1 | cmd2 | cmd3".
+type Pipeline struct {
+	stages   []*PipelineStage
+	stderr   bool
+	combined bool
+	stdout   io.Writer
+	stderrW  io.Writer
+}
+
+// NewPipeline returns a Pipeline that runs stages in order, piping the
+// standard output of each stage but the last into the standard input of the
+// next one.
+func NewPipeline(stages ...*PipelineStage) *Pipeline {
+	return &Pipeline{stages: stages}
+}
+
+// PipeStderr makes the Pipeline pipe each stage's standard error, instead of
+// its standard output, into the next stage's standard input. It must be
+// called before Run.
+func (p *Pipeline) PipeStderr() *Pipeline {
+	p.stderr = true
+	return p
+}
+
+// PipeCombinedOutput makes the Pipeline pipe each stage's combined standard
+// output and standard error into the next stage's standard input. It must be
+// called before Run.
+func (p *Pipeline) PipeCombinedOutput() *Pipeline {
+	p.combined = true
+	return p
+}
+
+// Stdout makes the Pipeline write the last stage's standard output to w,
+// instead of wherever the last stage's Shell was configured to write it to.
+// It must be called before Run.
+func (p *Pipeline) Stdout(w io.Writer) *Pipeline {
+	p.stdout = w
+	return p
+}
+
+// Stderr makes the Pipeline write the last stage's standard error to w (or,
+// if PipeStderr was requested, every stage's standard error), instead of
+// wherever the corresponding Shell was configured to write it to. It must be
+// called before Run.
+func (p *Pipeline) Stderr(w io.Writer) *Pipeline {
+	p.stderrW = w
+	return p
+}
+
+// Clone returns a copy of p that can be run independently of p: changes made
+// to the clone via PipeStderr, PipeCombinedOutput, Stdout or Stderr do not
+// affect p, and vice versa. The clone reuses the same stages, and therefore
+// the same underlying Shells, as p, so the clone's Run and p's Run must not
+// be called concurrently (neither must two Runs of the same clone) — Shell
+// is not safe for concurrent Exec calls. Build the clone's stages on fresh
+// Shells instead if you need to run both at the same time.
+func (p *Pipeline) Clone() *Pipeline {
+	stages := make([]*PipelineStage, len(p.stages))
+	copy(stages, p.stages)
+	return &Pipeline{
+		stages:   stages,
+		stderr:   p.stderr,
+		combined: p.combined,
+		stdout:   p.stdout,
+		stderrW:  p.stderrW,
+	}
+}
+
+// Run executes every stage of the pipeline and blocks until the last one has
+// finished. It returns the exit code of every stage, in the order the stages
+// were given to NewPipeline, and an aggregate error if any stage could not be
+// run (a non-zero exit code is not treated as an error).
+func (p *Pipeline) Run() ([]int, error) {
+	if len(p.stages) == 0 {
+		return nil, nil
+	}
+
+	codes := make([]int, len(p.stages))
+	errs := make([]error, len(p.stages))
+
+	var wg sync.WaitGroup
+	var stdin ExecOption
+
+	for i, st := range p.stages {
+		i, st := i, st
+		last := i == len(p.stages)-1
+
+		opts := []ExecOption{}
+		if stdin != nil {
+			opts = append(opts, stdin)
+			stdin = nil
+		}
+
+		// Snapshot the writers st.sh had before this stage, so they can be
+		// restored once the stage is done: NewPipelineStage promises the
+		// Shell's writer is only taken over for the duration of the stage.
+		origStdout := st.sh.currentStdoutWriters()
+		origStderr := st.sh.currentStderrWriters()
+
+		var pw *io.PipeWriter
+		if !last {
+			var pr *io.PipeReader
+			pr, pw = io.Pipe()
+			switch {
+			case p.combined:
+				st.sh.setStdoutWriters([]io.Writer{pw})
+				st.sh.setStderrWriters([]io.Writer{pw})
+			case p.stderr:
+				st.sh.setStderrWriters([]io.Writer{pw})
+			default:
+				st.sh.setStdoutWriters([]io.Writer{pw})
+			}
+			stdin = WithStdin(pr)
+		} else {
+			if p.stdout != nil {
+				st.sh.setStdoutWriters([]io.Writer{p.stdout})
+			}
+			if p.stderrW != nil {
+				st.sh.setStderrWriters([]io.Writer{p.stderrW})
+			}
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code, err := st.sh.Exec(st.cmd, opts...)
+			if pw != nil {
+				pw.Close()
+			}
+			st.sh.setStdoutWriters(origStdout)
+			st.sh.setStderrWriters(origStderr)
+			codes[i], errs[i] = code, err
+		}()
+	}
+
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return codes, fmt.Errorf("shell: run pipeline: %w", err)
+	}
+	return codes, nil
+}
@@ -0,0 +1,120 @@
+package shell_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/alepinio/shell"
+)
+
+func ExamplePipeline() {
+	sh1, err := shell.New("/bin/bash", nil, "/", os.Stdout, nil)
+	if err != nil {
+		panic(err)
+	}
+	sh2, err := shell.New("/bin/bash", nil, "/", os.Stdout, nil)
+	if err != nil {
+		panic(err)
+	}
+	defer sh1.Stop()
+	defer sh2.Stop()
+
+	stage1 := shell.NewPipelineStage(sh1, "printf 'foo\\nbar\\n'")
+	stage2 := shell.NewPipelineStage(sh2, "grep bar")
+
+	codes, err := stage1.PipeTo(stage2).Run()
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Print(codes)
+	// Output: bar
+	// [0 0]
+}
+
+func ExamplePipeline_stdout() {
+	sh1, err := shell.New("/bin/bash", nil, "/", os.Stdout, nil)
+	if err != nil {
+		panic(err)
+	}
+	sh2, err := shell.New("/bin/bash", nil, "/", os.Stdout, nil)
+	if err != nil {
+		panic(err)
+	}
+	defer sh1.Stop()
+	defer sh2.Stop()
+
+	var buf bytes.Buffer
+	pipeline := shell.NewPipeline(
+		shell.NewPipelineStage(sh1, "echo foo"),
+		shell.NewPipelineStage(sh2, "cat"),
+	).Stdout(&buf)
+
+	if _, err := pipeline.Run(); err != nil {
+		panic(err)
+	}
+
+	fmt.Print(buf.String())
+	// Output: foo
+}
+
+// TestPipelineRunRestoresWriters checks that a Shell used as a non-last
+// stage can still be used after Run, rather than being left writing to the
+// pipe that fed the next stage (and that Run already closed).
+func TestPipelineRunRestoresWriters(t *testing.T) {
+	var buf1, buf2 bytes.Buffer
+	sh1, err := shell.New("/bin/bash", nil, "/", &buf1, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer sh1.Stop()
+	sh2, err := shell.New("/bin/bash", nil, "/", &buf2, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer sh2.Stop()
+
+	stage1 := shell.NewPipelineStage(sh1, "echo foo")
+	stage2 := shell.NewPipelineStage(sh2, "cat")
+	if _, err := stage1.PipeTo(stage2).Run(); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if _, err := sh1.Exec("echo bar"); err != nil {
+		t.Fatalf("Exec after Run: %v", err)
+	}
+	if got, want := buf1.String(), "bar\n"; got != want {
+		t.Fatalf("buf1 = %q, want %q", got, want)
+	}
+}
+
+// TestPipelineCloneIsIndependent checks that configuring a clone via Stdout
+// does not affect the Pipeline it was cloned from, and vice versa.
+func TestPipelineCloneIsIndependent(t *testing.T) {
+	sh, err := shell.New("/bin/bash", nil, "/", os.Stdout, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer sh.Stop()
+
+	p := shell.NewPipeline(shell.NewPipelineStage(sh, "echo foo"))
+	clone := p.Clone()
+
+	var cloneBuf bytes.Buffer
+	clone.Stdout(&cloneBuf)
+
+	var pBuf bytes.Buffer
+	p.Stdout(&pBuf)
+
+	if _, err := clone.Run(); err != nil {
+		t.Fatalf("clone.Run: %v", err)
+	}
+	if got, want := cloneBuf.String(), "foo\n"; got != want {
+		t.Fatalf("cloneBuf = %q, want %q", got, want)
+	}
+	if got := pBuf.String(); got != "" {
+		t.Fatalf("pBuf = %q, want empty: configuring clone.Stdout must not affect p", got)
+	}
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// sigInterrupt and sigKill are the signals ExecContext uses to, respectively,
+// ask a command to stop and force it to stop.
+var (
+	sigInterrupt os.Signal = syscall.SIGINT
+	sigKill      os.Signal = syscall.SIGKILL
+)
+
+// procAttrs returns the platform-specific process attributes used to start
+// the shell process in its own process group, so that signalProcessGroup can
+// later target it and everything it spawned.
+func procAttrs() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
+
+// signalProcessGroup sends sig to every process in the group led by pid.
+func signalProcessGroup(pid int, sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return fmt.Errorf("shell: %T is not a syscall.Signal", sig)
+	}
+	if err := syscall.Kill(-pid, s); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return err
+	}
+	return nil
+}
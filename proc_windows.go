@@ -0,0 +1,41 @@
+//go:build windows
+
+package shell
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// sigInterrupt and sigKill are the signals ExecContext uses to, respectively,
+// ask a command to stop and force it to stop. Windows has no equivalent of
+// POSIX signals; os.Interrupt and os.Kill are the only values os.Process.Signal
+// accepts there, and signalProcessGroup below treats them both as a forceful
+// kill of the whole job (see its doc comment).
+var (
+	sigInterrupt os.Signal = os.Interrupt
+	sigKill      os.Signal = os.Kill
+)
+
+// procAttrs returns the platform-specific process attributes used to start
+// the shell process. CREATE_NEW_PROCESS_GROUP makes it the root of its own
+// process group, which taskkill's /T flag then uses in signalProcessGroup to
+// terminate it together with everything it spawned.
+func procAttrs() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// signalProcessGroup terminates the process group led by pid. Unlike its
+// Unix counterpart, it cannot distinguish an interrupt from a kill: Windows
+// only delivers Ctrl+Break to a whole process group, and console
+// applications are free to ignore it, so taskkill's forceful termination is
+// used for both of ExecContext's escalation steps.
+func signalProcessGroup(pid int, sig os.Signal) error {
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(pid)).Run(); err != nil {
+		return fmt.Errorf("taskkill process group %d: %w", pid, err)
+	}
+	return nil
+}
@@ -1,240 +1,725 @@
 // Package shell provides interactive and persistent shell processes inside
 // goroutines.
 //
-// It is built on top of package os/exec. A Unix system and a bash shell is
-// assumed for this package to run correctly.
+// It is built on top of package os/exec. By default it drives an
+// interactive bash shell, but other command languages (a POSIX sh, zsh,
+// Windows PowerShell, cmd.exe) are supported through the Dialect interface
+// and NewWithDialect.
 package shell
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
-	"syscall"
+	"time"
 )
 
 // ProcessStopped is the error returned when Exec is called after Stop.
 var ProcessStopped = errors.New("shell process already stopped")
 
+// interruptGracePeriod is how long ExecContext waits after interrupting the
+// shell's process group before escalating to a forceful kill.
+const interruptGracePeriod = 2 * time.Second
+
 // A Shell represents a shell process in preparation or execution, this last
 // with or without jobs. It can receive one or many calls to its method Exec.
 // The state of the shell process persists between calls to Exec, that is to
 // say, after doing a call to Exec the next one happens in the state left by the
 // previous call. A Shell cannot be used after calling its method Stop.
 type Shell struct {
-	c                *exec.Cmd
-	stdinPipe        io.WriteCloser
-	stdout           io.Writer
-	stderr           io.Writer
-	stdoutPipePath   string
-	stderrPipePath   string
-	exitCodePipePath string
-	tempDirPath      string
-	stdStreamCommCmd string
-	exitCodeCommCmd  string
-	wg               sync.WaitGroup
-	wgcounter        int
+	c         *exec.Cmd
+	dialect   Dialect
+	transport Transport
+	stdinPipe io.WriteCloser
+
+	stdoutAddr        string
+	stderrAddr        string
+	exitCodeAddr      string
+	stdinRedirectAddr string
+
+	writersMu     sync.Mutex
+	stdoutEnabled bool
+	stderrEnabled bool
+	stdoutWriters []io.Writer
+	stderrWriters []io.Writer
+
+	wg sync.WaitGroup
+
+	mu       sync.Mutex
+	pipeErrs []error
+
+	// processMu guards c.Process and waitDone/waitErr below. Exec and
+	// ExecContext only touch them from the one goroutine driving a given
+	// call, which needs no lock, but Signal and Terminate are meant to be
+	// called from another goroutine while such a call is in flight (see
+	// their doc comments), so writing them in start and reading them there
+	// must go through processMu to avoid a data race.
+	processMu sync.Mutex
+
+	stopped  bool
+	waitDone chan struct{}
+	waitErr  error
+}
+
+// shellConfig holds the options accepted by NewWithDialect.
+type shellConfig struct {
+	env    []string
+	dir    string
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// Option customizes a Shell created by NewWithDialect.
+type Option func(*shellConfig)
+
+// WithEnv sets the initial environment of the shell process.
+func WithEnv(env []string) Option {
+	return func(c *shellConfig) {
+		c.env = env
+	}
+}
+
+// WithDir sets the initial working directory of the shell process.
+func WithDir(dir string) Option {
+	return func(c *shellConfig) {
+		c.dir = dir
+	}
+}
+
+// WithStdout registers w as the first standard output writer of the Shell,
+// exactly as the stdout parameter of New does. More can be added later with
+// AddStdoutWriter.
+func WithStdout(w io.Writer) Option {
+	return func(c *shellConfig) {
+		c.stdout = w
+	}
+}
+
+// WithStderr registers w as the first standard error writer of the Shell,
+// exactly as the stderr parameter of New does. More can be added later with
+// AddStderrWriter.
+func WithStderr(w io.Writer) Option {
+	return func(c *shellConfig) {
+		c.stderr = w
+	}
 }
 
 // New returns a Shell struct ready to be used, where bin is the path to the
 // shell executable to run, env the initial environment, dir the initial working
 // directory and stdout and stderr where to redirect the standard output and
-// error of the commands executed in the shell process.
-func New(bin string, env []string, dir string, stdout, stderr io.Writer) *Shell {
-	// Create an empty Shell
-	s := Shell{}
+// error of the commands executed in the shell process. bin is assumed to be
+// a bash executable; use NewWithDialect to drive a different shell language.
+// New returns an error if any of the resources the Shell needs (pipes,
+// temporary directory) cannot be set up.
+func New(bin string, env []string, dir string, stdout, stderr io.Writer) (*Shell, error) {
+	return NewWithDialect(bin, BashDialect{}, WithEnv(env), WithDir(dir), WithStdout(stdout), WithStderr(stderr))
+}
 
-	// Create an exec.Cmd for the shell process
-	s.c = &exec.Cmd{
-		Path:   bin,
-		Args:   []string{bin},
-		Env:    env,
-		Dir:    dir,
-		Stdout: nil,
-		Stderr: nil,
+// NewWithDialect is the general purpose counterpart of New: bin is the path
+// to the shell executable to run, dialect describes its command-line syntax
+// and the IPC transport it requires (see Dialect, BashDialect,
+// PosixShDialect, ZshDialect, PowerShellDialect and CmdDialect), and opts
+// configures the environment, working directory and standard stream writers
+// of the Shell.
+func NewWithDialect(bin string, dialect Dialect, opts ...Option) (*Shell, error) {
+	var cfg shellConfig
+	for _, opt := range opts {
+		opt(&cfg)
 	}
 
-	// Set where to copy the standard output and standard error of the commands
-	// executed in the shell process
-	s.stdout = stdout
-	s.stderr = stderr
+	s := Shell{dialect: dialect}
+
+	// Create an exec.Cmd for the shell process, in its own process group so
+	// that a signal can later be delivered to it and every process it
+	// spawned (see ExecContext and Signal/Terminate) without also hitting
+	// the process where the Shell lives.
+	s.c = &exec.Cmd{
+		Path:        bin,
+		Args:        []string{bin},
+		Env:         cfg.env,
+		Dir:         cfg.dir,
+		Stdout:      nil,
+		Stderr:      nil,
+		SysProcAttr: procAttrs(),
+	}
 
 	// Create a pipe to write to the standard input of the shell process from
 	// the process where the Shell is
-	if stdinPipe, err := s.c.StdinPipe(); err != nil {
-		panic(err)
-	} else {
-		s.stdinPipe = stdinPipe
-	}
-
-	// Create a temporary directory where to put the named pipes that a Shell
-	// use
-	if tempDirPath, err := ioutil.TempDir("", "shell-named-pipes"); err != nil {
-		panic(err)
-	} else {
-		s.tempDirPath = tempDirPath
-	}
-
-	// Create a 0600 (user can read, user can write) named pipes for the shell
-	// process to communicate standard streams of executed commands to the
-	// process where the Shell is
-	if s.stdout != nil {
-		s.stdoutPipePath = filepath.Join(s.tempDirPath, "stdout")
-		if err := syscall.Mkfifo(s.stdoutPipePath, 0600); err != nil {
-			panic(err)
+	stdinPipe, err := s.c.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("shell: create stdin pipe: %w", err)
+	}
+	s.stdinPipe = stdinPipe
+
+	// Create the transport the dialect's command lines need to communicate
+	// standard streams and exit codes back to the process where the Shell is
+	transport, err := dialect.NewTransport()
+	if err != nil {
+		return nil, fmt.Errorf("shell: create transport: %w", err)
+	}
+	s.transport = transport
+
+	// Create the channel used to communicate the exit code of executed
+	// commands to the process where the Shell is
+	exitCodeAddr, err := transport.Create("exit_code")
+	if err != nil {
+		return nil, fmt.Errorf("shell: create exit code channel: %w", err)
+	}
+	s.exitCodeAddr = exitCodeAddr
+
+	// Register the initial standard output and standard error writers (if
+	// any); more can be added and removed later with AddStdoutWriter,
+	// RemoveStdoutWriter, AddStderrWriter and RemoveStderrWriter
+	if cfg.stdout != nil {
+		if err := s.enableStdout(); err != nil {
+			return nil, err
 		}
+		s.stdoutWriters = append(s.stdoutWriters, cfg.stdout)
 	}
-	if s.stderr != nil {
-		s.stderrPipePath = filepath.Join(s.tempDirPath, "stderr")
-		if err := syscall.Mkfifo(s.stderrPipePath, 0600); err != nil {
-			panic(err)
+	if cfg.stderr != nil {
+		if err := s.enableStderr(); err != nil {
+			return nil, err
 		}
+		s.stderrWriters = append(s.stderrWriters, cfg.stderr)
 	}
 
-	// Create a 0600 (user can read, user can write) named pipe for the shell
-	// process to communicate the exit code of executed commands to the process
-	// where the Shell is
-	s.exitCodePipePath = filepath.Join(s.tempDirPath, "exit_code")
-	if err := syscall.Mkfifo(s.exitCodePipePath, 0600); err != nil {
-		panic(err)
+	// Return a Shell ready to use
+	return &s, nil
+}
+
+// enableStdout lazily creates the channel used to carry the standard output
+// of executed commands back to the process where the Shell is. It is
+// idempotent: calling it more than once is a no-op.
+func (s *Shell) enableStdout() error {
+	if s.stdoutEnabled {
+		return nil
 	}
+	addr, err := s.transport.Create("stdout")
+	if err != nil {
+		return fmt.Errorf("shell: create stdout channel: %w", err)
+	}
+	s.stdoutAddr = addr
+	s.stdoutEnabled = true
+	return nil
+}
 
-	// Create command string for redirection of standard output and error of
-	// executed commands to pipes
-	if s.stdout != nil {
-		s.stdStreamCommCmd += fmt.Sprintf("1>%s", s.stdoutPipePath)
+// enableStderr lazily creates the channel used to carry the standard error
+// of executed commands back to the process where the Shell is. It is
+// idempotent: calling it more than once is a no-op.
+func (s *Shell) enableStderr() error {
+	if s.stderrEnabled {
+		return nil
+	}
+	addr, err := s.transport.Create("stderr")
+	if err != nil {
+		return fmt.Errorf("shell: create stderr channel: %w", err)
 	}
-	if s.stderr != nil {
-		s.stdStreamCommCmd += fmt.Sprintf(" 2>%s", s.stderrPipePath)
+	s.stderrAddr = addr
+	s.stderrEnabled = true
+	return nil
+}
+
+// AddStdoutWriter adds w to the set of writers that receive a copy of the
+// standard output of every command executed in s from now on, in addition to
+// any writer already registered (by New, WithStdout or a previous call to
+// AddStdoutWriter). It can be called between calls to Exec, for instance to
+// capture a single command's output without affecting the others.
+func (s *Shell) AddStdoutWriter(w io.Writer) error {
+	s.writersMu.Lock()
+	defer s.writersMu.Unlock()
+	if err := s.enableStdout(); err != nil {
+		return err
 	}
+	s.stdoutWriters = append(s.stdoutWriters, w)
+	return nil
+}
 
-	// Create exit code communication command string
-	s.exitCodeCommCmd = fmt.Sprintf("echo $? 1>%s", s.exitCodePipePath)
+// RemoveStdoutWriter removes w from the set of writers that receive a copy of
+// the standard output of executed commands. It is a no-op if w was not
+// registered.
+func (s *Shell) RemoveStdoutWriter(w io.Writer) {
+	s.writersMu.Lock()
+	defer s.writersMu.Unlock()
+	s.stdoutWriters = removeWriter(s.stdoutWriters, w)
+}
 
-	// Set value for wait group counter (exit code is always communicated to the
-	// process where the Shell is)
-	s.wgcounter += 1
-	if s.stdout != nil {
-		s.wgcounter += 1
+// AddStderrWriter adds w to the set of writers that receive a copy of the
+// standard error of every command executed in s from now on, in addition to
+// any writer already registered (by New, WithStderr or a previous call to
+// AddStderrWriter). It can be called between calls to Exec, for instance to
+// capture a single command's output without affecting the others.
+func (s *Shell) AddStderrWriter(w io.Writer) error {
+	s.writersMu.Lock()
+	defer s.writersMu.Unlock()
+	if err := s.enableStderr(); err != nil {
+		return err
 	}
-	if s.stderr != nil {
-		s.wgcounter += 1
+	s.stderrWriters = append(s.stderrWriters, w)
+	return nil
+}
+
+// RemoveStderrWriter removes w from the set of writers that receive a copy of
+// the standard error of executed commands. It is a no-op if w was not
+// registered.
+func (s *Shell) RemoveStderrWriter(w io.Writer) {
+	s.writersMu.Lock()
+	defer s.writersMu.Unlock()
+	s.stderrWriters = removeWriter(s.stderrWriters, w)
+}
+
+// removeWriter returns ws with the first writer equal to w (if any) removed.
+func removeWriter(ws []io.Writer, w io.Writer) []io.Writer {
+	for i, ww := range ws {
+		if ww == w {
+			return append(ws[:i:i], ws[i+1:]...)
+		}
 	}
+	return ws
+}
 
-	// Return a Shell ready to use
-	return &s
+// setStdoutWriters replaces, for the duration of the next call to Exec or
+// ExecContext, the set of writers that receive the standard output of
+// executed commands. It is used internally by Pipeline to splice a stage's
+// standard output into the next stage's standard input.
+func (s *Shell) setStdoutWriters(ws []io.Writer) {
+	s.writersMu.Lock()
+	defer s.writersMu.Unlock()
+	s.stdoutWriters = ws
+}
+
+// setStderrWriters is the Pipeline counterpart of setStdoutWriters for
+// standard error.
+func (s *Shell) setStderrWriters(ws []io.Writer) {
+	s.writersMu.Lock()
+	defer s.writersMu.Unlock()
+	s.stderrWriters = ws
+}
+
+// currentStdoutWriters returns a snapshot of the writers currently
+// registered for standard output. Pipeline uses it to restore a stage's
+// original writers once it is done splicing one in with setStdoutWriters.
+func (s *Shell) currentStdoutWriters() []io.Writer {
+	s.writersMu.Lock()
+	defer s.writersMu.Unlock()
+	return append([]io.Writer(nil), s.stdoutWriters...)
+}
+
+// currentStderrWriters is the standard error counterpart of
+// currentStdoutWriters.
+func (s *Shell) currentStderrWriters() []io.Writer {
+	s.writersMu.Lock()
+	defer s.writersMu.Unlock()
+	return append([]io.Writer(nil), s.stderrWriters...)
+}
+
+// ExecOption customizes a single call to Exec or ExecContext.
+type ExecOption func(*execOpts)
+
+// execOpts holds the options accepted by Exec and ExecContext.
+type execOpts struct {
+	stdin io.Reader
+}
+
+// WithStdin makes the executed command read its standard input from r,
+// instead of from the shell's own standard input. This is what lets a
+// Pipeline feed one stage's output into the next stage's input.
+func WithStdin(r io.Reader) ExecOption {
+	return func(o *execOpts) {
+		o.stdin = r
+	}
 }
 
 // Exec executes the command cmd in the shell process s and returns the
-// corresponding exit code.
-func (s *Shell) Exec(cmd string) int {
-	// Throw a meaningful error if Stop was already called. If the temporary
-	// directory does not exist, then it is supossed that the shell process
-	// was stopped
-	if _, err := os.Stat(s.tempDirPath); os.IsNotExist(err) {
-		panic(err)
+// corresponding exit code. It is equivalent to calling ExecContext with
+// context.Background.
+func (s *Shell) Exec(cmd string, opts ...ExecOption) (int, error) {
+	return s.ExecContext(context.Background(), cmd, opts...)
+}
+
+// ExecContext executes the command cmd in the shell process s and returns the
+// corresponding exit code. If ctx is cancelled or its deadline is exceeded
+// before cmd finishes, ExecContext interrupts the shell's process group and,
+// if the command has not finished after a short grace period, escalates to
+// a forceful kill. In that case ExecContext returns ctx.Err() and the Shell
+// should no longer be used other than to call Stop.
+func (s *Shell) ExecContext(ctx context.Context, cmd string, opts ...ExecOption) (int, error) {
+	var o execOpts
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// Throw a meaningful error if Stop was already called
+	if s.stopped {
+		return 0, ProcessStopped
 	}
 
 	// Start the shell process if it was not started yet (only happens in first
 	// call to Exec)
 	if s.c.Process == nil {
-		s.start()
+		if err := s.start(); err != nil {
+			return 0, err
+		}
 	}
 
+	// If the caller supplied a Stdin reader, redirect the command's standard
+	// input from a dedicated channel fed by a copy goroutine, instead of
+	// from the shell's own standard input.
+	var stdinRedirect string
+	wgcounter := 1 // exit code is always communicated back
+	var stdinAddr string
+	if o.stdin != nil {
+		if err := s.ensureStdinRedirectChannel(); err != nil {
+			return 0, err
+		}
+		stdinRedirect = s.dialect.RedirectStdin(s.stdinRedirectAddr)
+		stdinAddr = s.stdinRedirectAddr
+		wgcounter++
+	}
+
+	// Build the standard output/error redirection and snapshot the writers
+	// currently registered, so that writers added or removed by the caller
+	// while this call is in flight do not race with the dispatch goroutines
+	// below
+	var stdoutAddr, stderrAddr string
+	s.writersMu.Lock()
+	if s.stdoutEnabled {
+		stdoutAddr = s.stdoutAddr
+		wgcounter++
+	}
+	if s.stderrEnabled {
+		stderrAddr = s.stderrAddr
+		wgcounter++
+	}
+	stdoutWriters := append([]io.Writer(nil), s.stdoutWriters...)
+	stderrWriters := append([]io.Writer(nil), s.stderrWriters...)
+	s.writersMu.Unlock()
+	stdStreamRedirect := s.dialect.RedirectStdStreams(stdoutAddr, stderrAddr)
+
 	// Append interprocess communication paraphernalia to the command to execute
-	cmd2 := fmt.Sprintf("%s %s ; %s\n", cmd, s.stdStreamCommCmd, s.exitCodeCommCmd)
+	cmd2 := fmt.Sprintf("%s %s %s %s %s\n",
+		cmd, stdinRedirect, stdStreamRedirect,
+		s.dialect.CommandSeparator(), s.dialect.ExitCodeCommand(s.exitCodeAddr))
 
 	// Initialize wait group
-	s.wg.Add(s.wgcounter)
-
-	// Copy data from the stdout pipe (if the pipe is empty os.Open will block
-	// until someone writes to the pipe and closes it; if the pipe is being
-	// written os.Open will block until the one writing finishes and closes the
-	// pipe) to the process where the Shell is
-	if s.stdout != nil {
-		go copyFromPipe(s.stdoutPipePath, s.stdout, &s.wg)
+	s.mu.Lock()
+	s.pipeErrs = nil
+	s.mu.Unlock()
+	s.wg.Add(wgcounter)
+
+	// Copy data from the stdout channel (if it is empty, opening it for
+	// reading will block until someone writes to it and closes it; if it is
+	// being written, opening it will block until the one writing finishes
+	// and closes it) to every writer currently registered for standard
+	// output
+	if s.stdoutEnabled {
+		go s.copyFromChannel(s.stdoutAddr, io.MultiWriter(stdoutWriters...))
 	}
 
-	// Copy data from the stderr pipe to the process where the Shell is
-	if s.stderr != nil {
-		go copyFromPipe(s.stderrPipePath, s.stderr, &s.wg)
+	// Copy data from the stderr channel to every writer currently registered
+	// for standard error
+	if s.stderrEnabled {
+		go s.copyFromChannel(s.stderrAddr, io.MultiWriter(stderrWriters...))
 	}
 
-	// Copy data from exit code pipe to the process where the Shell is
+	// Copy data from the exit code channel to the process where the Shell is
 	var exitCodeBuf strings.Builder
-	go copyFromPipe(s.exitCodePipePath, &exitCodeBuf, &s.wg)
+	go s.copyFromChannel(s.exitCodeAddr, &exitCodeBuf)
+
+	// Copy data from the caller-supplied reader into the command's standard
+	// input channel
+	if o.stdin != nil {
+		go s.copyToChannel(s.stdinRedirectAddr, o.stdin)
+	}
 
 	// Send command to shell process (it is executed when shell process reads
 	// newline character)
-	io.WriteString(s.stdinPipe, cmd2)
+	if _, err := io.WriteString(s.stdinPipe, cmd2); err != nil {
+		s.wg.Add(-wgcounter)
+		return 0, fmt.Errorf("shell: write command to stdin: %w", err)
+	}
+
+	// done is closed once every channel has been fully copied, which only
+	// happens once the command (and the trailing echo of its exit code) has
+	// finished
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		// Fall through to exit code parsing below
+	case <-s.waitDone:
+		// The shell process died on its own, so no dialect fragment of
+		// cmd2 will ever reach it; abandon this call's channels so their
+		// goroutines, and the wait group they decrement, are not left
+		// blocked on an Open or Accept nobody will ever complete.
+		s.abandonChannels(stdoutAddr, stderrAddr, s.exitCodeAddr, stdinAddr)
+		return 0, fmt.Errorf("shell: process exited unexpectedly: %w", s.waitErr)
+	case <-ctx.Done():
+		finished, err := s.interruptThenKill(done)
+		if err != nil {
+			s.abandonChannels(stdoutAddr, stderrAddr, s.exitCodeAddr, stdinAddr)
+			return 0, err
+		}
+		if !finished {
+			// The process was killed before reaching every dialect
+			// fragment of cmd2 (most commonly the trailing exit code
+			// echo); abandon this call's channels for the same reason as
+			// above.
+			s.abandonChannels(stdoutAddr, stderrAddr, s.exitCodeAddr, stdinAddr)
+		}
+		return 0, ctx.Err()
+	}
 
-	// Wait until all data is copied from pipes
-	s.wg.Wait()
+	if err := s.pipeErr(); err != nil {
+		return 0, err
+	}
 
-	// Trim newline character in exit code pipe data
+	// Trim newline character in exit code channel data
 	exitCodeString := strings.TrimSpace(exitCodeBuf.String())
 
 	// Convert exit code string to int
 	exitCode, err := strconv.Atoi(exitCodeString)
 	if err != nil {
-		panic(err)
+		return 0, fmt.Errorf("shell: parse exit code %q: %w", exitCodeString, err)
+	}
+
+	return exitCode, nil
+}
+
+// interruptThenKill interrupts the shell's process group and waits for
+// either done or s.waitDone to close. If neither happens within
+// interruptGracePeriod, it escalates to a forceful kill and waits for the
+// process to die. finished reports whether done closed on its own, as
+// opposed to the shell process dying first: the caller uses it to tell
+// whether this call's transport channels need to be abandoned (see
+// abandonChannels), since a process that died mid-command may never have
+// reached every dialect fragment that would have opened them.
+func (s *Shell) interruptThenKill(done <-chan struct{}) (finished bool, err error) {
+	if err := s.signalProcessGroup(sigInterrupt); err != nil {
+		return false, fmt.Errorf("shell: interrupt process group: %w", err)
+	}
+
+	timer := time.NewTimer(interruptGracePeriod)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return true, nil
+	case <-s.waitDone:
+		return false, nil
+	case <-timer.C:
+	}
+
+	if err := s.signalProcessGroup(sigKill); err != nil {
+		return false, fmt.Errorf("shell: kill process group: %w", err)
+	}
+
+	select {
+	case <-done:
+		return true, nil
+	case <-s.waitDone:
+		return false, nil
+	}
+}
+
+// signalProcessGroup sends sig to every process in the shell process' group.
+func (s *Shell) signalProcessGroup(sig os.Signal) error {
+	s.processMu.Lock()
+	proc := s.c.Process
+	s.processMu.Unlock()
+	if proc == nil {
+		return nil
+	}
+	return signalProcessGroup(proc.Pid, sig)
+}
+
+// Signal sends sig to every process in s's process group: the shell process
+// itself and, since Exec starts it in its own group (see procAttrs), any
+// command and descendants a call to Exec currently in flight spawned. Unlike
+// ExecContext, it does not wait for the command to react; it lets a caller
+// abort an Exec stuck in another goroutine by reaching for the whole job
+// directly.
+func (s *Shell) Signal(sig os.Signal) error {
+	if err := s.signalProcessGroup(sig); err != nil {
+		return fmt.Errorf("shell: signal: %w", err)
 	}
+	return nil
+}
+
+// Terminate sends sig to s's process group, as Signal does, and then blocks
+// until the shell process itself has exited, returning the error (if any) it
+// exited with. Unlike Stop, Terminate does not close the Shell's stdin pipe
+// or release its transport; a well-behaved caller still calls Stop
+// afterwards to release those.
+func (s *Shell) Terminate(sig os.Signal) error {
+	if err := s.Signal(sig); err != nil {
+		return err
+	}
+
+	s.processMu.Lock()
+	proc, waitDone := s.c.Process, s.waitDone
+	s.processMu.Unlock()
+	if proc == nil {
+		return nil
+	}
+
+	<-waitDone
+	s.processMu.Lock()
+	waitErr := s.waitErr
+	s.processMu.Unlock()
+	if waitErr != nil {
+		return fmt.Errorf("shell: wait for process: %w", waitErr)
+	}
+	return nil
+}
 
-	return exitCode
+// pipeErr returns the first error (if any) that copyFromChannel recorded
+// during the last call to Exec or ExecContext.
+func (s *Shell) pipeErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return errors.Join(s.pipeErrs...)
 }
 
 // Stop stops the shell process s and releases the resources associated with it.
-func (s *Shell) Stop() {
-	// Throw a meaningful error if Stop was already called. If the temporary
-	// directory does not exist, then it is supossed that the shell process
-	// was stopped
-	if _, err := os.Stat(s.tempDirPath); os.IsNotExist(err) {
-		panic(ProcessStopped)
+func (s *Shell) Stop() error {
+	// Throw a meaningful error if Stop was already called
+	if s.stopped {
+		return ProcessStopped
 	}
+	s.stopped = true
 
-	// Remove the temporary directory where named pipes were put
-	if err := os.RemoveAll(s.tempDirPath); err != nil {
-		panic(err)
+	// Release the transport's resources (named pipes, listeners, ...)
+	if err := s.transport.Close(); err != nil {
+		return fmt.Errorf("shell: close transport: %w", err)
 	}
 
 	// Close stdin pipe (exec.Cmd.Wait will wait forever if stdin pipe is not
 	// closed)
 	if err := s.stdinPipe.Close(); err != nil {
-		panic(err)
+		return fmt.Errorf("shell: close stdin pipe: %w", err)
 	}
 
 	// Wait for the stdin pipe to be closed, any copying from stdout or stderr
 	// to complete, and release resources associated with the exec Cmd. Do not
 	// wait if shell process was not started (say, if no call to Exec was done)
 	if s.c.Process != nil {
-		if err := s.c.Wait(); err != nil {
-			panic(err)
+		<-s.waitDone
+		if s.waitErr != nil {
+			return fmt.Errorf("shell: wait for process: %w", s.waitErr)
+		}
+	}
+
+	return nil
+}
+
+// copyFromChannel copies data from a transport channel and tells wait group
+// when finishes. Any error is recorded on s and surfaced by the call to Exec
+// or ExecContext currently in flight.
+func (s *Shell) copyFromChannel(addr string, writer io.Writer) {
+	defer s.wg.Done()
+
+	r, err := s.transport.OpenRead(addr)
+	if err != nil {
+		s.recordPipeErr(fmt.Errorf("shell: open channel %s: %w", addr, err))
+		return
+	}
+	defer r.Close()
+
+	if _, err := io.Copy(writer, r); err != nil {
+		s.recordPipeErr(fmt.Errorf("shell: copy from channel %s: %w", addr, err))
+	}
+}
+
+// copyToChannel copies data from r into a transport channel and tells wait
+// group when finishes. Any error is recorded on s and surfaced by the call
+// to Exec or ExecContext currently in flight.
+func (s *Shell) copyToChannel(addr string, r io.Reader) {
+	defer s.wg.Done()
+
+	w, err := s.transport.OpenWrite(addr)
+	if err != nil {
+		s.recordPipeErr(fmt.Errorf("shell: open channel %s: %w", addr, err))
+		return
+	}
+	defer w.Close()
+
+	if _, err := io.Copy(w, r); err != nil {
+		s.recordPipeErr(fmt.Errorf("shell: copy to channel %s: %w", addr, err))
+	}
+}
+
+// abandonChannels unblocks any copyFromChannel or copyToChannel goroutine of
+// the call that allocated addrs and is stuck in Transport.OpenRead or
+// OpenWrite because the shell process died or was killed before reaching
+// the dialect fragment that would have opened the other side. It is best
+// effort: Abandon errors are not recorded, since the call these channels
+// belong to is already being abandoned anyway. Empty addresses (a channel
+// this call did not use) are skipped.
+func (s *Shell) abandonChannels(addrs ...string) {
+	for _, addr := range addrs {
+		if addr == "" {
+			continue
 		}
+		s.transport.Abandon(addr)
 	}
 }
 
-// copyFromPipe copies data from a named pipe and tells wait group when
-// finishes
-func copyFromPipe(pipePath string, writer io.Writer, wg *sync.WaitGroup) {
-	defer wg.Done()
-	pipe, err := os.Open(pipePath)
+// ensureStdinRedirectChannel lazily creates the channel used to redirect a
+// command's standard input when called with WithStdin.
+func (s *Shell) ensureStdinRedirectChannel() error {
+	if s.stdinRedirectAddr != "" {
+		return nil
+	}
+	addr, err := s.transport.Create("stdin_redirect")
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("shell: create stdin redirect channel: %w", err)
 	}
-	io.Copy(writer, pipe)
-	pipe.Close()
+	s.stdinRedirectAddr = addr
+	return nil
+}
+
+// recordPipeErr appends err to the list of errors surfaced by the next call
+// to pipeErr.
+func (s *Shell) recordPipeErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pipeErrs = append(s.pipeErrs, err)
 }
 
 // start starts the shell process s.
-func (s *Shell) start() {
-	// Start exec.Cmd
-	if err := s.c.Start(); err != nil {
-		panic(err)
+func (s *Shell) start() error {
+	// c.Process and waitDone are written under processMu so that Signal and
+	// Terminate, called concurrently from another goroutine, read them
+	// without racing with this call (see processMu's doc comment).
+	s.processMu.Lock()
+	err := s.c.Start()
+	if err != nil {
+		s.processMu.Unlock()
+		return fmt.Errorf("shell: start process: %w", err)
 	}
+
+	// Wait for the process in the background so that ExecContext and Stop can
+	// notice the process dying without either of them having to call
+	// exec.Cmd.Wait themselves (it may only be called once).
+	s.waitDone = make(chan struct{})
+	s.processMu.Unlock()
+	go func() {
+		waitErr := s.c.Wait()
+		s.processMu.Lock()
+		s.waitErr = waitErr
+		s.processMu.Unlock()
+		close(s.waitDone)
+	}()
+
+	return nil
 }
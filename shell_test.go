@@ -2,15 +2,24 @@ package shell_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"runtime"
 	"strings"
+	"syscall"
+	"testing"
+	"time"
 
 	"github.com/alepinio/shell"
 )
 
 func Example_1() {
-	s := shell.New("/bin/bash", nil, "/", os.Stdout, nil)
+	s, err := shell.New("/bin/bash", nil, "/", os.Stdout, nil)
+	if err != nil {
+		panic(err)
+	}
 
 	s.Exec("echo foo")
 	s.Stop()
@@ -20,7 +29,10 @@ func Example_1() {
 
 func Example_2() {
 	var buf bytes.Buffer
-	s := shell.New("/bin/bash", nil, "/", &buf, nil)
+	s, err := shell.New("/bin/bash", nil, "/", &buf, nil)
+	if err != nil {
+		panic(err)
+	}
 
 	s.Exec("cd tmp")
 	s.Exec("pwd")
@@ -32,7 +44,10 @@ func Example_2() {
 
 func Example_3() {
 	var buf bytes.Buffer
-	s := shell.New("/bin/bash", []string{"FOO=0"}, "/", &buf, nil)
+	s, err := shell.New("/bin/bash", []string{"FOO=0"}, "/", &buf, nil)
+	if err != nil {
+		panic(err)
+	}
 
 	s.Exec("export FOO=1")
 	s.Exec("echo $FOO")
@@ -44,7 +59,10 @@ func Example_3() {
 
 func Example_4() {
 	var buf bytes.Buffer
-	s := shell.New("/bin/bash", nil, "/", nil, &buf)
+	s, err := shell.New("/bin/bash", nil, "/", nil, &buf)
+	if err != nil {
+		panic(err)
+	}
 
 	s.Exec("man")
 	s.Stop()
@@ -56,7 +74,10 @@ func Example_4() {
 func Example_5() {
 	var buf bytes.Buffer
 	var buff bytes.Buffer
-	s := shell.New("/bin/bash", nil, "/", &buf, &buff)
+	s, err := shell.New("/bin/bash", nil, "/", &buf, &buff)
+	if err != nil {
+		panic(err)
+	}
 
 	s.Exec("echo foo")
 	s.Exec("man")
@@ -67,11 +88,151 @@ func Example_5() {
 }
 
 func Example_6() {
-	s := shell.New("/bin/bash", nil, "/", nil, nil)
+	s, err := shell.New("/bin/bash", nil, "/", nil, nil)
+	if err != nil {
+		panic(err)
+	}
 
-	exitCode := s.Exec("test 1 -le 2")
+	exitCode, _ := s.Exec("test 1 -le 2")
 	s.Stop()
 
 	fmt.Print(exitCode)
 	// Output: 0
 }
+
+func TestExecContextCancel(t *testing.T) {
+	s, err := shell.New("/bin/bash", nil, "/", nil, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer s.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err = s.ExecContext(ctx, "sleep 60")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("ExecContext error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("ExecContext took %v to honor cancellation", elapsed)
+	}
+}
+
+func TestExecContextDeadlineExceeded(t *testing.T) {
+	s, err := shell.New("/bin/bash", nil, "/", nil, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer s.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	_, err = s.ExecContext(ctx, "sleep 60")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ExecContext error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestExecContextDeadlineExceededDoesNotLeakGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	s, err := shell.New("/bin/bash", nil, "/", nil, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := s.ExecContext(ctx, "sleep 60"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ExecContext error = %v, want context.DeadlineExceeded", err)
+	}
+	if err := s.Stop(); err == nil {
+		t.Fatal("Stop error = nil, want error since the process was killed")
+	}
+
+	// The goroutines copying the killed command's standard streams and exit
+	// code back were, before this fix, stuck forever in Transport.OpenRead
+	// because the shell process never reached the dialect fragment that
+	// would have opened the other side; give them every chance to have
+	// leaked before checking.
+	time.Sleep(500 * time.Millisecond)
+	runtime.GC()
+
+	if after := runtime.NumGoroutine(); after > before {
+		buf := make([]byte, 1<<20)
+		n := runtime.Stack(buf, true)
+		t.Fatalf("goroutines leaked: before=%d after=%d\n%s", before, after, buf[:n])
+	}
+}
+
+func TestExecContextShellDeath(t *testing.T) {
+	s, err := shell.New("/bin/bash", nil, "/", nil, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer s.Stop()
+
+	_, err = s.ExecContext(context.Background(), "kill -9 $$")
+	if err == nil {
+		t.Fatal("ExecContext error = nil, want error about unexpected exit")
+	}
+}
+
+func TestTerminate(t *testing.T) {
+	s, err := shell.New("/bin/bash", nil, "/", nil, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	go s.Exec("sleep 60")
+	time.Sleep(200 * time.Millisecond)
+
+	start := time.Now()
+	if err := s.Terminate(syscall.SIGKILL); err == nil {
+		t.Fatal("Terminate error = nil, want error about the shell process being killed")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Terminate took %v to kill the process group", elapsed)
+	}
+
+	// The shell process (and sleep with it) is gone, so Stop should find it
+	// already reaped rather than hang waiting on it.
+	if err := s.Stop(); err == nil {
+		t.Fatal("Stop error = nil, want error since the process was already killed")
+	}
+}
+
+func TestSignal(t *testing.T) {
+	s, err := shell.New("/bin/bash", nil, "/", nil, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer s.Stop()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Exec("sleep 60")
+		done <- err
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	start := time.Now()
+	if err := s.Signal(syscall.SIGINT); err != nil {
+		t.Fatalf("Signal: %v", err)
+	}
+
+	select {
+	case <-done:
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Fatalf("Exec took %v to react to Signal", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Exec did not return after Signal")
+	}
+}
@@ -0,0 +1,39 @@
+package shell
+
+import "io"
+
+// Transport creates and wires the interprocess-communication channels that
+// let a Shell and a Dialect's command line fragments talk to each other.
+// BashDialect, PosixShDialect and ZshDialect use a POSIX named-pipe (FIFO)
+// transport; PowerShellDialect and CmdDialect, which target Windows where
+// FIFOs created with syscall.Mkfifo are unavailable, use a Windows named
+// pipe transport instead, addressed the same way from their command
+// fragments' point of view (a file-like path their native redirection
+// operators can open directly).
+type Transport interface {
+	// Create allocates a new channel called name and returns the address a
+	// dialect's command fragment should use to reach it (a file path for
+	// the named-pipe transport, a loopback address for the TCP transport).
+	Create(name string) (string, error)
+
+	// OpenRead opens a previously created channel for the Go side to read
+	// from.
+	OpenRead(addr string) (io.ReadCloser, error)
+
+	// OpenWrite opens a previously created channel for the Go side to write
+	// to.
+	OpenWrite(addr string) (io.WriteCloser, error)
+
+	// Abandon unblocks a goroutine stuck in OpenRead or OpenWrite on addr
+	// because the dialect's command fragment that should have opened the
+	// other side never ran (the shell process died or was killed first). It
+	// does so by opening that other side itself, just long enough for the
+	// blocked call to return, then closing without exchanging any data.
+	// Exec and ExecContext call it on the channels of a call that is being
+	// abandoned, so their reader/writer goroutines (and the wait group they
+	// decrement) are not left blocked forever.
+	Abandon(addr string) error
+
+	// Close releases every resource the transport allocated.
+	Close() error
+}
@@ -0,0 +1,69 @@
+//go:build !windows
+
+package shell
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// fifoTransport is the Transport used by BashDialect, PosixShDialect and
+// ZshDialect: it puts one named pipe (FIFO) per channel in a private
+// temporary directory.
+type fifoTransport struct {
+	dir string
+}
+
+// newFIFOTransport creates the temporary directory that will hold the
+// transport's named pipes.
+func newFIFOTransport() (Transport, error) {
+	dir, err := ioutil.TempDir("", "shell-named-pipes")
+	if err != nil {
+		return nil, fmt.Errorf("shell: create temporary directory: %w", err)
+	}
+	return &fifoTransport{dir: dir}, nil
+}
+
+// Create creates a 0600 (user can read, user can write) named pipe called
+// name in the transport's temporary directory.
+func (t *fifoTransport) Create(name string) (string, error) {
+	path := filepath.Join(t.dir, name)
+	if err := syscall.Mkfifo(path, 0600); err != nil {
+		return "", fmt.Errorf("create %s named pipe: %w", name, err)
+	}
+	return path, nil
+}
+
+// OpenRead opens the named pipe at addr for reading. If the pipe is empty
+// this blocks until someone writes to it and closes it; if the pipe is
+// being written, this blocks until the one writing finishes and closes it.
+func (t *fifoTransport) OpenRead(addr string) (io.ReadCloser, error) {
+	return os.Open(addr)
+}
+
+// OpenWrite opens the named pipe at addr for writing.
+func (t *fifoTransport) OpenWrite(addr string) (io.WriteCloser, error) {
+	return os.OpenFile(addr, os.O_WRONLY, 0)
+}
+
+// Abandon opens the named pipe at addr for both reading and writing, which
+// POSIX guarantees never blocks, and immediately closes it. That unblocks
+// whichever single-sided OpenRead or OpenWrite call was waiting on addr: it
+// now has a peer, and gets EOF (or a closed pipe on write) since Abandon
+// never transfers any data.
+func (t *fifoTransport) Abandon(addr string) error {
+	f, err := os.OpenFile(addr, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Close removes the transport's temporary directory and every named pipe in it.
+func (t *fifoTransport) Close() error {
+	return os.RemoveAll(t.dir)
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package shell
+
+import "errors"
+
+// newFIFOTransport always fails on Windows: syscall.Mkfifo, and the POSIX
+// FIFOs it creates, do not exist there. BashDialect, PosixShDialect and
+// ZshDialect are therefore not usable on Windows; use PowerShellDialect or
+// CmdDialect instead, which use newNamedPipeTransport.
+func newFIFOTransport() (Transport, error) {
+	return nil, errors.New("shell: named pipes are not supported on Windows; use PowerShellDialect or CmdDialect")
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package shell
+
+import "errors"
+
+// newNamedPipeTransport always fails off Windows: Windows named pipes, and
+// the Win32 APIs that create them, do not exist there. PowerShellDialect and
+// CmdDialect are therefore only usable on Windows; use BashDialect,
+// PosixShDialect or ZshDialect instead, which use newFIFOTransport.
+func newNamedPipeTransport() (Transport, error) {
+	return nil, errors.New("shell: named pipes are not supported outside Windows; use BashDialect, PosixShDialect or ZshDialect")
+}
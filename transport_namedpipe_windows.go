@@ -0,0 +1,171 @@
+//go:build windows
+
+package shell
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+// namedPipeTransport is the Transport used by PowerShellDialect and
+// CmdDialect: each channel is a Windows named pipe, addressed by the
+// \\.\pipe\NAME path that cmd.exe's and PowerShell's native redirection
+// operators (and [IO.File] APIs) can open like any other file path, the same
+// way fifoTransport's named pipes are addressed by POSIX shells. Unlike a
+// POSIX FIFO, a Windows named pipe needs its creating side to explicitly
+// wait for a peer with ConnectNamedPipe before each use, which is what
+// OpenRead and OpenWrite do here.
+type namedPipeTransport struct {
+	mu      sync.Mutex
+	handles map[string]syscall.Handle
+}
+
+var pipeSeq uint64
+
+// newNamedPipeTransport returns a Transport backed by Windows named pipes.
+func newNamedPipeTransport() (Transport, error) {
+	return &namedPipeTransport{handles: make(map[string]syscall.Handle)}, nil
+}
+
+var (
+	modkernel32             = syscall.NewLazyDLL("kernel32.dll")
+	procCreateNamedPipeW    = modkernel32.NewProc("CreateNamedPipeW")
+	procConnectNamedPipe    = modkernel32.NewProc("ConnectNamedPipe")
+	procDisconnectNamedPipe = modkernel32.NewProc("DisconnectNamedPipe")
+)
+
+const (
+	pipeAccessDuplex       = 0x00000003
+	pipeTypeByte           = 0x00000000
+	pipeWait               = 0x00000000
+	pipeUnlimitedInstances = 255
+	pipeBufferSize         = 65536
+	errorPipeConnected     = syscall.Errno(535)
+)
+
+// Create creates a Windows named pipe called name and returns the
+// \\.\pipe\... path a dialect's command fragment should use to reach it.
+func (t *namedPipeTransport) Create(name string) (string, error) {
+	n := atomic.AddUint64(&pipeSeq, 1)
+	addr := fmt.Sprintf(`\\.\pipe\shell-%d-%d-%s`, os.Getpid(), n, name)
+
+	pAddr, err := syscall.UTF16PtrFromString(addr)
+	if err != nil {
+		return "", fmt.Errorf("shell: encode %s pipe address: %w", name, err)
+	}
+
+	h, _, callErr := procCreateNamedPipeW.Call(
+		uintptr(unsafe.Pointer(pAddr)),
+		uintptr(pipeAccessDuplex),
+		uintptr(pipeTypeByte|pipeWait),
+		uintptr(pipeUnlimitedInstances),
+		uintptr(pipeBufferSize),
+		uintptr(pipeBufferSize),
+		0,
+		0,
+	)
+	if syscall.Handle(h) == syscall.InvalidHandle {
+		return "", fmt.Errorf("shell: create %s named pipe: %w", name, callErr)
+	}
+
+	t.mu.Lock()
+	t.handles[addr] = syscall.Handle(h)
+	t.mu.Unlock()
+	return addr, nil
+}
+
+// OpenRead waits for the dialect's command fragment to connect to the named
+// pipe at addr and returns a reader wrapping it, the same way
+// fifoTransport's OpenRead blocks until a FIFO gets a writer.
+func (t *namedPipeTransport) OpenRead(addr string) (io.ReadCloser, error) {
+	return t.connect(addr)
+}
+
+// OpenWrite is the write-side counterpart of OpenRead.
+func (t *namedPipeTransport) OpenWrite(addr string) (io.WriteCloser, error) {
+	return t.connect(addr)
+}
+
+// Abandon connects to the named pipe at addr as a client, the same role a
+// dialect's command fragment would have taken, and immediately disconnects
+// without exchanging any data. That unblocks whichever OpenRead or OpenWrite
+// call was waiting in ConnectNamedPipe on addr.
+func (t *namedPipeTransport) Abandon(addr string) error {
+	pAddr, err := syscall.UTF16PtrFromString(addr)
+	if err != nil {
+		return err
+	}
+	h, err := syscall.CreateFile(pAddr, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil, syscall.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return err
+	}
+	return syscall.CloseHandle(h)
+}
+
+func (t *namedPipeTransport) connect(addr string) (*namedPipeConn, error) {
+	t.mu.Lock()
+	h, ok := t.handles[addr]
+	t.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown channel address %s", addr)
+	}
+
+	ok2, _, callErr := procConnectNamedPipe.Call(uintptr(h), 0)
+	if ok2 == 0 && callErr != errorPipeConnected {
+		return nil, fmt.Errorf("shell: connect named pipe %s: %w", addr, callErr)
+	}
+	return &namedPipeConn{h: h}, nil
+}
+
+// Close disconnects and closes every named pipe the transport created.
+func (t *namedPipeTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var err error
+	for _, h := range t.handles {
+		procDisconnectNamedPipe.Call(uintptr(h))
+		if cerr := syscall.CloseHandle(h); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// namedPipeConn is the read and write side of a connected named pipe handle.
+// Close disconnects the current peer instead of closing the handle, so the
+// same pipe can be reused across every Exec call the channel lives for, the
+// same way a FIFO's path is.
+type namedPipeConn struct {
+	h syscall.Handle
+}
+
+func (c *namedPipeConn) Read(p []byte) (int, error) {
+	var n uint32
+	err := syscall.ReadFile(c.h, p, &n, nil)
+	if err == syscall.ERROR_BROKEN_PIPE || (err == nil && n == 0) {
+		return int(n), io.EOF
+	}
+	return int(n), err
+}
+
+func (c *namedPipeConn) Write(p []byte) (int, error) {
+	var n uint32
+	err := syscall.WriteFile(c.h, p, &n, nil)
+	return int(n), err
+}
+
+func (c *namedPipeConn) Close() error {
+	// DisconnectNamedPipe discards any bytes still sitting in the pipe's
+	// kernel buffer that the peer hasn't read yet; FlushFileBuffers first
+	// blocks until the peer has drained them, so a write side that Closes
+	// right after its last Write does not silently truncate it.
+	syscall.FlushFileBuffers(c.h)
+	_, _, _ = procDisconnectNamedPipe.Call(uintptr(c.h))
+	return nil
+}
@@ -0,0 +1,90 @@
+package shell
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// validVarName matches the shells' own rules for a valid variable name, and
+// is used to reject names that could otherwise break out of the synthetic
+// commands AwaitVars, Get and Set build.
+var validVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// AwaitVars reads the current value of every variable in names from the
+// running shell session and returns them keyed by name. It fails if any name
+// is not a valid shell variable name.
+func (s *Shell) AwaitVars(names ...string) (map[string]string, error) {
+	if len(names) == 0 {
+		return map[string]string{}, nil
+	}
+
+	refs := make([]string, len(names))
+	for i, name := range names {
+		if !validVarName.MatchString(name) {
+			return nil, fmt.Errorf("shell: await vars: %q is not a valid variable name", name)
+		}
+		refs[i] = s.dialect.VarRef(name)
+	}
+
+	// Swap in a scratch buffer as the only stdout writer for the probe
+	// command below, instead of adding to whatever writers the Shell was
+	// already configured with: the NUL-delimited payload PrintNULCommand
+	// prints is not meant for the caller's own stdout sink, only for us to
+	// parse back out.
+	if err := s.enableStdout(); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	origStdout := s.currentStdoutWriters()
+	s.setStdoutWriters([]io.Writer{&buf})
+	defer s.setStdoutWriters(origStdout)
+
+	cmd := s.dialect.PrintNULCommand(refs)
+	if _, err := s.Exec(cmd); err != nil {
+		return nil, fmt.Errorf("shell: await vars: %w", err)
+	}
+
+	values := strings.Split(strings.TrimSuffix(buf.String(), "\x00"), "\x00")
+	if len(values) != len(names) {
+		return nil, fmt.Errorf("shell: await vars: expected %d values, got %d", len(names), len(values))
+	}
+
+	vars := make(map[string]string, len(names))
+	for i, name := range names {
+		vars[name] = values[i]
+	}
+	return vars, nil
+}
+
+// Get reads the current value of the variable name from the running shell
+// session. It is shorthand for calling AwaitVars with a single name.
+func (s *Shell) Get(name string) (string, error) {
+	vars, err := s.AwaitVars(name)
+	if err != nil {
+		return "", err
+	}
+	return vars[name], nil
+}
+
+// Set exports the variable name with value in the running shell session, so
+// that it is visible to every command executed afterwards. Unlike callers
+// hand-writing "export FOO=...", Set quotes value so that it is taken
+// literally, whatever characters it contains.
+func (s *Shell) Set(name, value string) error {
+	if !validVarName.MatchString(name) {
+		return fmt.Errorf("shell: set %s: not a valid variable name", name)
+	}
+
+	cmd := s.dialect.ExportCommand(name, s.dialect.Quote(value))
+	exitCode, err := s.Exec(cmd)
+	if err != nil {
+		return fmt.Errorf("shell: set %s: %w", name, err)
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("shell: set %s: export exited with code %d", name, exitCode)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package shell_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/alepinio/shell"
+)
+
+func ExampleShell_Set() {
+	s, err := shell.New("/bin/bash", nil, "/", nil, nil)
+	if err != nil {
+		panic(err)
+	}
+	defer s.Stop()
+
+	if err := s.Set("FOO", "bar baz"); err != nil {
+		panic(err)
+	}
+
+	value, err := s.Get("FOO")
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Print(value)
+	// Output: bar baz
+}
+
+func ExampleShell_AwaitVars() {
+	s, err := shell.New("/bin/bash", nil, "/", nil, nil)
+	if err != nil {
+		panic(err)
+	}
+	defer s.Stop()
+
+	s.Exec("FOO=1; BAR=2")
+
+	vars, err := s.AwaitVars("FOO", "BAR")
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Print(vars["FOO"], vars["BAR"])
+	// Output: 12
+}
+
+// TestAwaitVarsDoesNotLeakToCallerStdout checks that the NUL-delimited
+// payload AwaitVars uses to read variables back does not also reach the
+// Shell's own stdout writer, which a caller may be using for its own
+// purposes.
+func TestAwaitVarsDoesNotLeakToCallerStdout(t *testing.T) {
+	var mainOut bytes.Buffer
+	s, err := shell.New("/bin/bash", nil, "/", &mainOut, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer s.Stop()
+
+	if _, err := s.Exec("echo hello"); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if _, err := s.Exec("FOO=1"); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+
+	if _, err := s.AwaitVars("FOO"); err != nil {
+		t.Fatalf("AwaitVars: %v", err)
+	}
+
+	if _, err := s.Exec("echo world"); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+
+	if got, want := mainOut.String(), "hello\nworld\n"; got != want {
+		t.Fatalf("mainOut = %q, want %q", got, want)
+	}
+}
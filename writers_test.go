@@ -0,0 +1,28 @@
+package shell_test
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/alepinio/shell"
+)
+
+func ExampleShell_AddStdoutWriter() {
+	s, err := shell.New("/bin/bash", nil, "/", nil, nil)
+	if err != nil {
+		panic(err)
+	}
+	defer s.Stop()
+
+	var buf bytes.Buffer
+	if err := s.AddStdoutWriter(&buf); err != nil {
+		panic(err)
+	}
+
+	s.Exec("echo foo")
+	s.RemoveStdoutWriter(&buf)
+	s.Exec("echo bar")
+
+	fmt.Print(buf.String())
+	// Output: foo
+}